@@ -1,7 +1,10 @@
 import os
+import stat
+import tempfile
 from pathlib import Path
 
 import click
+import pytz
 import requests
 
 from .config import Config
@@ -10,14 +13,35 @@ from .core import (
     notion_blog_database,
     page_to_markdown,
     page_path,
+    page_paths,
+    shortest_page_path,
+    last_edited_timestamp,
+    all_pages,
+    backup_blog,
+    block_types,
+    nested_block_types,
+    property_types,
     published_pages,
     draft_pages,
+    property_slug,
+    edited_within,
+    unsupported_blocks,
+    pages_to_csv,
+    pages_to_json_lines,
 )
+from .templates import supported_block_types, block_type
 from . import __version__
-from .logging import get_logger, toggle_debug, LOG_FILE_HANDLER, LOG_FMT
-from logging import INFO, DEBUG, ERROR
+from .logging import (
+    get_logger,
+    toggle_debug,
+    log_file_handler,
+    log_formatter,
+    enable_api_trace,
+)
+from logging import INFO, DEBUG, WARNING, ERROR
 
-logger = get_logger(INFO, LOG_FILE_HANDLER, LOG_FMT)
+# The log file handler is added in `runner`, once the log format is known.
+logger = get_logger(INFO)
 
 """
 `cli` Module only has thin wrappers around Notoma Python API
@@ -36,9 +60,36 @@ Run `notoma` for the help article on how to use the CLI.
     """
 )
 @click.option("--debug", is_flag=True, default=False, help="Enable debug output.")
-def runner(debug: bool = False) -> None:
+@click.option(
+    "--log-format",
+    default="text",
+    type=click.Choice(["text", "json"]),
+    help="Log file format.",
+)
+@click.option(
+    "--trace-api",
+    is_flag=True,
+    default=False,
+    help="Log Notion API requests, except the initial one, into a separate trace file.",
+)
+def runner(
+    debug: bool = False, log_format: str = "text", trace_api: bool = False
+) -> None:
+    config = Config()
+    try:
+        max_bytes, max_files = config.log_max_bytes, config.log_max_files
+    except ValueError as e:
+        __echo_and_log(f"Error: {e}", ERROR)
+        raise click.Abort()
+
+    handler = log_file_handler(config.log_file, max_bytes, max_files)
+    get_logger(INFO, handler, log_formatter(log_format))
+
     logger.info("Notoma CLI invoked.")
     toggle_debug(logger, debug)
+    if trace_api:
+        enable_api_trace(config.api_trace_file)
+        logger.info("Tracing Notion API requests.")
     pass
 
 
@@ -63,24 +114,157 @@ def version():
     type=click.Path(exists=True),
     help="Directory for draft posts. Drafts won't be imported if this is left blank.",
 )
+@click.option(
+    "--since",
+    default=None,
+    help="Only convert pages edited within this duration, like 12h, 30d or 8w.",
+)
 @click.option("--token_v2", "-t", help="Notion auth token from the cookie.")
 def convert(
-    dest: str, drafts: str, token_v2: str = None, notion_url: str = None,
+    dest: str,
+    drafts: str,
+    since: str = None,
+    token_v2: str = None,
+    notion_url: str = None,
 ) -> None:
-    config = Config(token_v2=token_v2, blog_url=notion_url)
+    config = Config(token_v2=token_v2, blog_url=notion_url, sync_window=since)
     __validate_config(config)
 
     dest = Path(dest).absolute()
+    __validate_path_length(
+        config, [dest] + ([Path(drafts).absolute()] if drafts else [])
+    )
+
     client = notion_client(config.token_v2)
     blog = notion_blog_database(client, config.blog_url)
 
     __echo_and_log(f"Processing articles from Notion: {blog.parent.title}")
 
+    if property_slug(blog, config.publish_property) is None:
+        __echo_and_log(
+            f"Error: The blog has no `{config.publish_property}` property. "
+            "Check NOTOMA_PUBLISH_PROPERTY.",
+            ERROR,
+        )
+        raise click.Abort()
+
     try:
-        __convert_pages(published_pages(blog), dest, config)
+        publish = (config.publish_property, config.publish_value)
+        posts = [(published_pages(blog, *publish), dest)]
         if drafts:
-            __convert_pages(draft_pages(blog), Path(drafts).absolute(), config)
-            draft_pages(blog)
+            posts.append((draft_pages(blog, *publish), Path(drafts).absolute()))
+
+        # Check drafts too, to fail before writing anything rather than midway.
+        if config.unsupported_blocks == "fail":
+            __validate_blocks(
+                [page for pages, _ in posts for page in __in_sync_window(pages, config)]
+            )
+
+        for pages, dest_dir in posts:
+            __convert_pages(pages, dest_dir, config)
+
+    except requests.exceptions.HTTPError as e:
+        __echo_and_log(e, ERROR)
+
+
+@runner.command(help="Export Notion Blog posts properties to a CSV or JSON lines file.")
+@click.option("--from", "-f", "notion_url", help="Notion blog URL")
+@click.option(
+    "--format",
+    "export_format",
+    default="csv",
+    type=click.Choice(["csv", "json"]),
+    help="Export file format.",
+)
+@click.option(
+    "--output",
+    "-o",
+    required=True,
+    type=click.Path(dir_okay=False, writable=True),
+    help="File to write the exported posts into.",
+)
+@click.option("--token_v2", "-t", help="Notion auth token from the cookie.")
+def export(
+    export_format: str, output: str, token_v2: str = None, notion_url: str = None,
+) -> None:
+    config = Config(token_v2=token_v2, blog_url=notion_url)
+    __validate_config(config)
+
+    client = notion_client(config.token_v2)
+    blog = notion_blog_database(client, config.blog_url)
+
+    __echo_and_log(f"Exporting articles from Notion: {blog.parent.title}")
+
+    try:
+        pages = all_pages(blog)
+        if export_format == "json":
+            exported = pages_to_json_lines(pages, config)
+        else:
+            exported = pages_to_csv(pages, config)
+
+        Path(output).write_text(exported)
+        __echo_and_log(f"Exported {len(pages)} pages to {output}.")
+
+    except requests.exceptions.HTTPError as e:
+        __echo_and_log(e, ERROR)
+
+
+@runner.command(help="Save raw Notion data of the Blog into a timestamped directory.")
+@click.option("--from", "-f", "notion_url", help="Notion blog URL")
+@click.option(
+    "--dest",
+    "-d",
+    default="backups",
+    type=click.Path(file_okay=False),
+    help="Directory to put backups into. Created if it doesn't exist.",
+)
+@click.option("--token_v2", "-t", help="Notion auth token from the cookie.")
+def backup(dest: str, token_v2: str = None, notion_url: str = None) -> None:
+    config = Config(token_v2=token_v2, blog_url=notion_url)
+    __validate_config(config)
+
+    client = notion_client(config.token_v2)
+    blog = notion_blog_database(client, config.blog_url)
+
+    __echo_and_log(f"Backing up Notion Blog: {blog.parent.title}")
+
+    try:
+        dest = Path(dest).absolute()
+        dest.mkdir(parents=True, exist_ok=True)
+        backup_dir = backup_blog(blog, dest)
+        __echo_and_log(f"Saved the backup to {backup_dir}.")
+
+    except requests.exceptions.HTTPError as e:
+        __echo_and_log(e, ERROR)
+
+
+@runner.command(help="Report block and property types used in the Notion Blog.")
+@click.option("--from", "-f", "notion_url", help="Notion blog URL")
+@click.option("--token_v2", "-t", help="Notion auth token from the cookie.")
+def audit(token_v2: str = None, notion_url: str = None) -> None:
+    config = Config(token_v2=token_v2, blog_url=notion_url)
+    __validate_config(config)
+
+    client = notion_client(config.token_v2)
+    blog = notion_blog_database(client, config.blog_url)
+
+    __echo_and_log(f"Auditing Notion Blog: {blog.parent.title}")
+
+    try:
+        pages = all_pages(blog)
+        supported = supported_block_types()
+        __echo_and_log("Block types:")
+        for name, count in block_types(pages).most_common():
+            note = "" if name in supported else "  (unsupported)"
+            __echo_and_log(f"{count:>8}  {name}{note}")
+
+        __echo_and_log("Nested block types:")
+        for name, count in nested_block_types(pages).most_common():
+            __echo_and_log(f"{count:>8}  {name}  (not rendered)")
+
+        __echo_and_log("Property types:")
+        for name, count in property_types(blog).most_common():
+            __echo_and_log(f"{count:>8}  {name}")
 
     except requests.exceptions.HTTPError as e:
         __echo_and_log(e, ERROR)
@@ -113,16 +297,102 @@ def new() -> None:
 def __convert_pages(pages: list, dest_dir: Path, config: Config) -> None:
     "Convert a bunch of pages with a nice progress bar."
 
+    # File names depend on other pages with the same title, so they are
+    # built for all the pages, even those outside of the sync window.
+    max_length = config.max_path_length
+    paths = page_paths(pages, dest_dir=dest_dir, max_length=max_length)
+
+    pages = __in_sync_window(pages, config)
     __echo_and_log(f"{len(pages)} pages to process.")
 
+    shortened = list()
     with click.progressbar(pages) as bar:
         for page in bar:
-            path = page_path(page, dest_dir=dest_dir)
-            page_markdown = page_to_markdown(page, config=config)
-            path.write_text(page_markdown)
+            path = paths[page.id]
+            renamed = path != page_path(page, dest_dir=dest_dir, max_length=max_length)
+            if renamed:
+                logger.warning(f"Page {page.title} has a duplicate title, renaming.")
+
+            if path != page_path(page, dest_dir=dest_dir, unique=renamed):
+                shortened.append(path)
+                logger.warning(f"Page {page.title} path is shortened to {path}.")
+
+            try:
+                page_markdown = page_to_markdown(page, config=config)
+            except ValueError as e:
+                __echo_and_log(f"Error: {e}", ERROR)
+                raise click.Abort()
+            __write_atomically(path, page_markdown, fsync_dir=config.fsync_dir)
+            if config.preserve_mtime:
+                edited_at = last_edited_timestamp(page)
+                os.utime(path, (edited_at, edited_at))
             logger.info(f"Processed page {page.title} and saved to {path}.")
 
     __echo_and_log(f"Processed {len(pages)} pages.")
+    if len(shortened) > 0:
+        __echo_and_log(f"Shortened file names of {len(shortened)} pages:", WARNING)
+        for path in shortened:
+            __echo_and_log(f"  {path.name}", WARNING)
+
+
+def __in_sync_window(pages: list, config: Config) -> list:
+    "Returns the pages edited within the configured sync window, or all of them."
+    if config.sync_window is None:
+        return pages
+    return edited_within(pages, config.sync_window)
+
+
+def __validate_blocks(pages: list) -> None:
+    "Prints blocks of the pages that can't be rendered, and aborts if there are any."
+    unsupported = unsupported_blocks(pages)
+    if len(unsupported) > 0:
+        for b in unsupported:
+            __echo_and_log(
+                f"Error: Unsupported block type: {block_type(b)} {b.get_browseable_url()}",
+                ERROR,
+            )
+        raise click.Abort()
+
+
+def __write_atomically(path: Path, text: str, fsync_dir: bool = False) -> None:
+    """
+    Writes `text` into a temporary file next to `path`, flushes it to disk,
+    and renames it to `path`, so that a crash never leaves a truncated post.
+    With `fsync_dir`, the directory is flushed too, to persist the rename.
+    """
+    mode = __file_mode(path)
+    f = tempfile.NamedTemporaryFile(
+        "w", dir=path.parent, prefix=f".{path.name}.", delete=False
+    )
+    try:
+        with f:
+            f.write(text)
+            f.flush()
+            os.fsync(f.fileno())
+        # Temporary files are owner-only, keep the mode a regular write would set.
+        os.chmod(f.name, mode)
+        os.replace(f.name, path)
+    except BaseException:
+        if os.path.exists(f.name):
+            os.unlink(f.name)
+        raise
+
+    if fsync_dir:
+        dir_fd = os.open(path.parent, os.O_RDONLY)
+        try:
+            os.fsync(dir_fd)
+        finally:
+            os.close(dir_fd)
+
+
+def __file_mode(path: Path) -> int:
+    "Returns the mode of the existing file at `path`, or the default mode for new files."
+    if path.exists():
+        return stat.S_IMODE(path.stat().st_mode)
+
+    umask = os.umask(0)
+    os.umask(umask)
+    return 0o666 & ~umask
 
 
 def __validate_config(config: Config) -> None:
@@ -139,6 +409,49 @@ def __validate_config(config: Config) -> None:
     if config.blog_url is None:
         errors.append("Error: Notion Blog URL is required. Try --from option.")
 
+    try:
+        config.sync_window
+    except ValueError as e:
+        errors.append(f"Error: {e} Check --since option.")
+
+    try:
+        config.empty_values
+    except ValueError as e:
+        errors.append(f"Error: {e} Check NOTOMA_EMPTY_VALUES.")
+
+    try:
+        config.unsupported_blocks
+    except ValueError as e:
+        errors.append(f"Error: {e} Check NOTOMA_UNSUPPORTED_BLOCKS.")
+
+    try:
+        config.max_path_length
+    except ValueError as e:
+        errors.append(f"Error: {e} Check NOTOMA_MAX_PATH_LENGTH.")
+
+    try:
+        config.timezone
+    except pytz.UnknownTimeZoneError as e:
+        errors.append(f"Error: Unknown timezone {e}. Check NOTOMA_TIMEZONE.")
+
+    if len(errors) > 0:
+        for e in errors:
+            __echo_and_log(e, ERROR)
+        raise click.Abort()
+
+
+def __validate_path_length(config: Config, dirs: list) -> None:
+    "Aborts if post file names can't fit into the max path length in any of the `dirs`."
+    max_length = config.max_path_length
+    if max_length is None:
+        return
+
+    errors = [
+        f"Error: Posts in {d} need paths of at least {shortest_page_path(d)} characters, "
+        f"but the max is {max_length}. Check NOTOMA_MAX_PATH_LENGTH."
+        for d in dirs
+        if max_length < shortest_page_path(d)
+    ]
     if len(errors) > 0:
         for e in errors:
             __echo_and_log(e, ERROR)
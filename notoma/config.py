@@ -1,6 +1,13 @@
 import os
+import re
+from datetime import timedelta, tzinfo
 from dotenv import load_dotenv, find_dotenv
 
+import pytz
+from tzlocal import get_localzone
+
+from .logging import LOG_FNAME, LOG_MAX_BYTES, LOG_MAX_FILES, API_TRACE_FNAME
+
 
 CONF_MAP = dict(
     token_v2="NOTOMA_NOTION_TOKEN_V2",
@@ -8,8 +15,37 @@ CONF_MAP = dict(
     default_layout="NOTOMA_DEFAULT_LAYOUT",
     permalink_pattern="NOTOMA_PERMALINK_PATTERN",
     baseurl="NOTOMA_BASE_URL",
+    publish_property="NOTOMA_PUBLISH_PROPERTY",
+    publish_value="NOTOMA_PUBLISH_VALUE",
+    code_languages="NOTOMA_CODE_LANGUAGES",
+    author_front_matter="NOTOMA_AUTHOR_FRONT_MATTER",
+    front_matter_order="NOTOMA_FRONT_MATTER_ORDER",
+    notion_url_front_matter="NOTOMA_NOTION_URL_FRONT_MATTER",
+    timezone="NOTOMA_TIMEZONE",
+    fsync_dir="NOTOMA_FSYNC_DIR",
+    preserve_mtime="NOTOMA_PRESERVE_MTIME",
+    sync_window="NOTOMA_SYNC_WINDOW",
+    empty_values="NOTOMA_EMPTY_VALUES",
+    unsupported_blocks="NOTOMA_UNSUPPORTED_BLOCKS",
+    max_path_length="NOTOMA_MAX_PATH_LENGTH",
+    log_file="NOTOMA_LOG_FILE",
+    log_max_bytes="NOTOMA_LOG_MAX_BYTES",
+    log_max_files="NOTOMA_LOG_MAX_FILES",
+    api_trace_file="NOTOMA_API_TRACE_FILE",
 )
 
+# Units of durations like `12h`, `30d` or `8w`.
+DURATION_UNITS = dict(h="hours", d="days", w="weeks")
+
+# How to write front matter properties that have no value.
+EMPTY_VALUE_POLICIES = ["omit", "null", "empty-string", "empty-list"]
+
+# How to render Notion blocks that don't have a template.
+UNSUPPORTED_BLOCK_POLICIES = ["text", "comment", "callout", "skip", "fail"]
+
+# Values of boolean settings that are treated as enabled.
+TRUTHY = ["1", "true", "yes", "on"]
+
 
 class Config:
     """
@@ -20,6 +56,49 @@ class Config:
         - `token_v2`: str, Notion authentication token. Environment variable
             `NOTOMA_NOTION_TOKEN_V2`.
         - `blog_url`: str, Notion Blog URL. `NOTOMA_NOTION_BLOG_URL`.
+        - `publish_property`: str, the property that marks published posts.
+            Defaults to `published`. `NOTOMA_PUBLISH_PROPERTY`.
+        - `publish_value`: str, the value of a select or status
+            `publish_property` that marks published posts. Leave it empty
+            for a checkbox property. `NOTOMA_PUBLISH_VALUE`.
+        - `code_languages`: dict, overrides for Notion code block language
+            to markdown fence mapping, written as `c++=cpp,plain text=text`.
+            `NOTOMA_CODE_LANGUAGES`.
+        - `author_front_matter`: bool, whether to add `author` and
+            `last_edited_by` Notion user names to front matter.
+            `NOTOMA_AUTHOR_FRONT_MATTER`.
+        - `front_matter_order`: list, comma separated front matter keys
+            that go first, the rest are sorted alphabetically. Defaults to
+            `title`. `NOTOMA_FRONT_MATTER_ORDER`.
+        - `notion_url_front_matter`: bool, whether to add the page Notion URL
+            as `notion_url` front matter. Defaults to true.
+            `NOTOMA_NOTION_URL_FRONT_MATTER`.
+        - `timezone`: tzinfo, `local` or an IANA timezone name to convert
+            front matter date times into. Date times are left in UTC
+            if it's not set. `NOTOMA_TIMEZONE`.
+        - `fsync_dir`: bool, whether to flush the posts directory to disk
+            after writing each post. `NOTOMA_FSYNC_DIR`.
+        - `preserve_mtime`: bool, whether to set post files modification
+            time to the Notion page last edited time. `NOTOMA_PRESERVE_MTIME`.
+        - `sync_window`: timedelta, only convert pages edited within this
+            duration, like `30d`. `NOTOMA_SYNC_WINDOW`.
+        - `empty_values`: str, one of `omit`, `null`, `empty-string` or
+            `empty-list`, how to write empty properties into front matter.
+            Defaults to `omit`. `NOTOMA_EMPTY_VALUES`.
+        - `unsupported_blocks`: str, one of `text`, `comment`, `callout`,
+            `skip` or `fail`, how to render blocks Notoma doesn't support.
+            Defaults to `text`. `NOTOMA_UNSUPPORTED_BLOCKS`.
+        - `max_path_length`: int, the longest post file path allowed,
+            longer file names are truncated. `NOTOMA_MAX_PATH_LENGTH`.
+        - `log_file`: str, the log file path. Defaults to `.notoma.log`.
+            `NOTOMA_LOG_FILE`.
+        - `log_max_bytes`: int, log file size to rotate it at.
+            Defaults to 10 MB. `NOTOMA_LOG_MAX_BYTES`.
+        - `log_max_files`: int, how many rotated log files to keep.
+            Defaults to 3. `NOTOMA_LOG_MAX_FILES`.
+        - `api_trace_file`: str, where `--trace-api` writes the Notion API
+            requests trace. Defaults to `.notoma-api.log`.
+            `NOTOMA_API_TRACE_FILE`.
     """
 
     def __init__(self, **kwargs):
@@ -45,6 +124,121 @@ class Config:
     def blog_url(self) -> str:
         return self.__config["blog_url"]
 
+    @property
+    def publish_property(self) -> str:
+        return self.__config["publish_property"] or "published"
+
+    @property
+    def publish_value(self) -> str:
+        return self.__config["publish_value"] or None
+
+    @property
+    def code_languages(self) -> dict:
+        mapping = dict()
+        for pair in (self.__config["code_languages"] or "").split(","):
+            if "=" in pair:
+                notion, fence = pair.split("=", 1)
+                mapping[notion.strip().lower()] = fence.strip()
+        return mapping
+
+    @property
+    def author_front_matter(self) -> bool:
+        return self.__flag("author_front_matter", default=False)
+
+    @property
+    def notion_url_front_matter(self) -> bool:
+        return self.__flag("notion_url_front_matter", default=True)
+
+    @property
+    def timezone(self) -> tzinfo:
+        name = self.__config["timezone"]
+        if name is None or name == "":
+            return None
+        if name.lower() == "local":
+            return get_localzone()
+        return pytz.timezone(name)
+
+    @property
+    def fsync_dir(self) -> bool:
+        return self.__flag("fsync_dir", default=False)
+
+    @property
+    def preserve_mtime(self) -> bool:
+        return self.__flag("preserve_mtime", default=False)
+
+    @property
+    def sync_window(self) -> timedelta:
+        window = self.__config["sync_window"]
+        if window is None or window == "":
+            return None
+
+        match = re.fullmatch(r"\s*(\d+)\s*([hdw])\s*", window.lower(), re.ASCII)
+        if match is None:
+            raise ValueError(f"Expected a duration like 12h, 30d or 8w, got {window}.")
+        amount, unit = match.groups()
+        return timedelta(**{DURATION_UNITS[unit]: int(amount)})
+
+    @property
+    def empty_values(self) -> str:
+        policy = (self.__config["empty_values"] or "omit").strip().lower()
+        if policy not in EMPTY_VALUE_POLICIES:
+            raise ValueError(
+                f"Expected empty values to be one of {', '.join(EMPTY_VALUE_POLICIES)}, got {policy}."
+            )
+        return policy
+
+    @property
+    def unsupported_blocks(self) -> str:
+        policy = (self.__config["unsupported_blocks"] or "text").strip().lower()
+        if policy not in UNSUPPORTED_BLOCK_POLICIES:
+            raise ValueError(
+                f"Expected unsupported blocks to be one of {', '.join(UNSUPPORTED_BLOCK_POLICIES)}, got {policy}."
+            )
+        return policy
+
+    @property
+    def max_path_length(self) -> int:
+        return self.__int("max_path_length", default=None)
+
+    @property
+    def log_file(self) -> str:
+        return self.__config["log_file"] or LOG_FNAME
+
+    @property
+    def log_max_bytes(self) -> int:
+        return self.__int("log_max_bytes", default=LOG_MAX_BYTES)
+
+    @property
+    def log_max_files(self) -> int:
+        return self.__int("log_max_files", default=LOG_MAX_FILES)
+
+    @property
+    def api_trace_file(self) -> str:
+        return self.__config["api_trace_file"] or API_TRACE_FNAME
+
+    @property
+    def front_matter_order(self) -> list:
+        order = self.__config["front_matter_order"] or "title"
+        return [k.strip() for k in order.split(",") if k.strip() != ""]
+
+    def __flag(self, key: str, default: bool) -> bool:
+        "Returns a boolean setting, or `default` if it's not set."
+        value = self.__config[key]
+        if value is None or value == "":
+            return default
+        return str(value).strip().lower() in TRUTHY
+
+    def __int(self, key: str, default: int) -> int:
+        "Returns a non-negative integer setting, or `default` if it's not set."
+        value = self.__config[key]
+        if value is None or value == "":
+            return default
+        if re.fullmatch(r"\s*\d+\s*", str(value), re.ASCII) is None:
+            raise ValueError(
+                f"Expected {CONF_MAP[key]} to be a non-negative integer, got {value}."
+            )
+        return int(value)
+
     def __getitem__(self, key):
         return self.__config[key]
 
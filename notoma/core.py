@@ -1,21 +1,58 @@
 from pathlib import Path
 from typing import Union, List
+from datetime import date, datetime, timedelta
+from logging import DEBUG
+import csv
+import io
+import json
+import time
+from collections import Counter
 
+import requests
 from notion.client import NotionClient
-from notion.block import PageBlock
+from notion.block import Block, PageBlock
 from notion.collection import Collection, NotionDate
 
 from .config import Config
-from .templates import load_template
-from .page import page_path, front_matter
+from .logging import API_LOGGER
+from .templates import load_template, block_type, supported_block_types
+from .page import (
+    page_path,
+    page_paths,
+    shortest_page_path,
+    front_matter,
+    last_edited_timestamp,
+)
 
 
 def notion_client(token_v2: str) -> NotionClient:
     config = Config(token_v2=token_v2)
     client = NotionClient(token_v2=config.token_v2)
+    # NotionClient loads user content as soon as it's created, and there's
+    # no way to hook into it's session before that, so that request is not traced.
+    client.session.hooks["response"].append(__trace_response)
     return client
 
 
+def __trace_response(response: requests.Response, *args, **kwargs) -> None:
+    """
+    Logs Notion API request method, endpoint, status, duration and the number
+    of retries into the API trace log. Query strings are dropped, so signed URLs
+    don't leak, and headers with the auth cookie are never logged.
+    """
+    if not API_LOGGER.isEnabledFor(DEBUG):
+        return
+
+    url = response.request.url.split("?")[0]
+    duration = response.elapsed.total_seconds() * 1000
+    retries = getattr(response.raw, "retries", None)
+    retry_count = len(retries.history) if retries is not None else 0
+    API_LOGGER.debug(
+        f"{response.request.method} {url} {response.status_code} {duration:.0f}ms "
+        f"retries={retry_count}"
+    )
+
+
 def notion_blog_database(client: NotionClient, db_url: str) -> Collection:
     """
     Returns a Notion database, wraped into a `notion.Collection` for
@@ -29,22 +66,174 @@ def all_pages(blog: Collection) -> List[PageBlock]:
     return blog.get_rows()
 
 
-def published_pages(blog: Collection) -> List[PageBlock]:
-    "Returns the list of published pages."
+def published_pages(
+    blog: Collection, publish_property: str = "published", publish_value: str = None
+) -> List[PageBlock]:
+    "Returns the list of pages that are published according to `publish_property`."
     # FIXME: This needs to be a filtered query instead.
-    return [post for post in blog.get_rows() if post.get_all_properties()["published"]]
+    slug = property_slug(blog, publish_property)
+    return [post for post in blog.get_rows() if __is_published(post, slug, publish_value)]
 
 
-def draft_pages(blog: Collection) -> List[PageBlock]:
-    "Returns the list of draft pages."
+def draft_pages(
+    blog: Collection, publish_property: str = "published", publish_value: str = None
+) -> List[PageBlock]:
+    "Returns the list of pages that are not published according to `publish_property`."
     # FIXME: This needs to be a filtered query instead.
+    slug = property_slug(blog, publish_property)
     return [
-        post for post in blog.get_rows() if not post.get_all_properties()["published"]
+        post
+        for post in blog.get_rows()
+        if not __is_published(post, slug, publish_value)
     ]
 
 
+def __is_published(post: PageBlock, publish_property: str, publish_value: str) -> bool:
+    """
+    Returns whether the post is published. Without `publish_value` the property
+    is expected to be a checkbox, otherwise it has to be equal to, or in case of
+    multi select contain, the `publish_value`.
+    """
+    value = post.get_all_properties()[publish_property]
+    if publish_value is None:
+        return bool(value)
+    if isinstance(value, list):
+        return publish_value in value
+    return str(value) == publish_value
+
+
+def property_slug(blog: Collection, name: str) -> str:
+    """
+    Returns the slug of the blog database property by it's name or slug,
+    as used in `get_all_properties`, or `None` if there's no such property.
+    """
+    prop = blog.get_schema_property(name)
+    return prop["slug"] if prop is not None else None
+
+
+def edited_within(pages: List[PageBlock], window: timedelta) -> List[PageBlock]:
+    "Returns the pages that were last edited within the `window` from now."
+    since = time.time() - window.total_seconds()
+    return [page for page in pages if last_edited_timestamp(page) >= since]
+
+
 def page_to_markdown(page: PageBlock, config: Config) -> str:
     "Translates a Notion Page (`PageBlock`) into a Markdown string and returns it."
     return load_template("post", debug=True, config=config).render(
         page=page, front_matter=front_matter(page, config)
     )
+
+
+def unsupported_blocks(pages: List[PageBlock]) -> List[Block]:
+    "Returns the blocks of the pages that the post template can't render."
+    supported = supported_block_types()
+    return [
+        child
+        for page in pages
+        for child in page.children
+        if block_type(child) not in supported
+    ]
+
+
+def block_types(pages: List[PageBlock]) -> Counter:
+    "Counts block types of the top level page blocks, the ones the post template renders."
+    return Counter(block_type(child) for page in pages for child in page.children)
+
+
+def nested_block_types(pages: List[PageBlock]) -> Counter:
+    "Counts block types of the blocks nested in top level page blocks, that aren't rendered."
+    counts = Counter()
+    for page in pages:
+        for child in page.children:
+            counts += __nested_block_types(child)
+    return counts
+
+
+def __nested_block_types(parent: Block) -> Counter:
+    "Counts block types of all the blocks nested in the `parent` block."
+    counts = Counter()
+    for child in parent.children:
+        counts[block_type(child)] += 1
+        counts += __nested_block_types(child)
+    return counts
+
+
+def property_types(blog: Collection) -> Counter:
+    "Counts property types in the blog database schema."
+    return Counter(prop["type"] for prop in blog.get("schema").values())
+
+
+def backup_blog(blog: Collection, dest_dir: Path) -> Path:
+    """
+    Saves raw Notion records of the blog database, all of it's pages
+    and their blocks as JSON files into a new timestamped directory
+    inside `dest_dir`, and returns the path to that directory.
+    """
+    # Microseconds keep backups started within the same second apart.
+    timestamp = datetime.utcnow().strftime("%Y%m%dT%H%M%S%f")
+    backup_dir = dest_dir / f"notoma-backup-{timestamp}"
+    pages_dir = backup_dir / "pages"
+    pages_dir.mkdir(parents=True)
+
+    __write_json(backup_dir / "collection.json", blog.get())
+
+    for page in all_pages(blog):
+        records = dict(page=page.get(), blocks=__block_records(page))
+        __write_json(pages_dir / f"{page.id}.json", records)
+
+    return backup_dir
+
+
+def __block_records(parent: Block) -> List[dict]:
+    "Returns raw records of all the blocks nested in the `parent` block, depth first."
+    records = list()
+    for child in parent.children:
+        records.append(child.get())
+        records += __block_records(child)
+    return records
+
+
+def __write_json(path: Path, data: Union[dict, list]) -> None:
+    "Writes `data` as pretty printed JSON into the file at `path`."
+    path.write_text(json.dumps(data, indent=2, ensure_ascii=False))
+
+
+def pages_to_json_lines(pages: List[PageBlock], config: Config) -> str:
+    "Serializes pages front matter into JSON lines, one page per line, and returns it."
+    lines = [
+        json.dumps(
+            __exportable(front_matter(page, config)), ensure_ascii=False, default=str
+        )
+        for page in pages
+    ]
+    return "\n".join(lines) + "\n"
+
+
+def pages_to_csv(pages: List[PageBlock], config: Config) -> str:
+    "Serializes pages front matter into a CSV table with a header row, and returns it."
+    rows = [__exportable(front_matter(page, config)) for page in pages]
+
+    # Pages may have different sets of non-empty properties,
+    # so the header is a union of all keys in the order they were seen.
+    fields = list()
+    for row in rows:
+        fields += [k for k in row.keys() if k not in fields]
+
+    output = io.StringIO()
+    writer = csv.DictWriter(output, fieldnames=fields)
+    writer.writeheader()
+    for row in rows:
+        writer.writerow(
+            {
+                k: ", ".join(str(i) for i in v) if isinstance(v, list) else v
+                for k, v in row.items()
+            }
+        )
+    return output.getvalue()
+
+
+def __exportable(props: dict) -> dict:
+    "Converts front matter values into JSON and CSV friendly types."
+    return {
+        k: v.isoformat() if isinstance(v, date) else v for k, v in props.items()
+    }
@@ -1,16 +1,49 @@
+import json
 import logging
+import logging.handlers
 
 LOG_FMT = "%(asctime)s %(name)s [%(levelname)s]: %(message)s -- %(module)s.%(funcName)s %(filename)s:%(lineno)s"
 LEVEL = logging.DEBUG
 LOG_FNAME = ".notoma.log"
 
-LOG_FILE_HANDLER = logging.FileHandler(LOG_FNAME, "w+")
+# Rotate the log file when it reaches the max size, and keep this many old files.
+LOG_MAX_BYTES = 10 * 1024 * 1024
+LOG_MAX_FILES = 3
+
 LOG_NULL_HANDLER = logging.NullHandler()
 
+# Notion API requests are traced into a separate file when enabled.
+API_TRACE_FNAME = ".notoma-api.log"
+API_LOGGER = logging.getLogger("notoma.api")
+API_LOGGER.propagate = False
+API_LOGGER.addHandler(LOG_NULL_HANDLER)
+
+
+class JsonFormatter(logging.Formatter):
+    "Formats log records as JSON objects, one per line."
+
+    def format(self, record: logging.LogRecord) -> str:
+        return json.dumps(
+            dict(
+                time=self.formatTime(record),
+                name=record.name,
+                level=record.levelname,
+                message=record.getMessage(),
+                module=record.module,
+                function=record.funcName,
+                line=record.lineno,
+            )
+        )
+
 
 def get_logger(level=LEVEL, handler=LOG_NULL_HANDLER, format=LOG_FMT):
-    "Returns a customized logger. Defaults to logging INFO to NullHandler."
-    handler.setFormatter(logging.Formatter(format))
+    """
+    Returns a customized logger. Defaults to logging INFO to NullHandler.
+    `format` is either a format string, or a `logging.Formatter`.
+    """
+    if not isinstance(format, logging.Formatter):
+        format = logging.Formatter(format)
+    handler.setFormatter(format)
     logger = logging.getLogger(__name__)
     logger.setLevel(LEVEL)
     logger.addHandler(handler)
@@ -30,3 +63,30 @@ def toggle_debug(logger: logging.Logger, debug: bool = False) -> None:
         logger.info("Setting log level to INFO")
         logger.setLevel(logging.INFO)  # info
     return logger
+
+
+def log_file_handler(
+    fname: str = LOG_FNAME,
+    max_bytes: int = LOG_MAX_BYTES,
+    max_files: int = LOG_MAX_FILES,
+) -> logging.Handler:
+    "Returns a log file handler that rotates the log when it reaches `max_bytes`."
+    return logging.handlers.RotatingFileHandler(
+        fname, maxBytes=max_bytes, backupCount=max_files
+    )
+
+
+def log_formatter(log_format: str = "text") -> logging.Formatter:
+    "Returns a formatter for `json` or `text` logs."
+    if log_format == "json":
+        return JsonFormatter()
+    return logging.Formatter(LOG_FMT)
+
+
+def enable_api_trace(fname: str = API_TRACE_FNAME) -> logging.Logger:
+    "Starts writing Notion API requests trace into `fname`, and returns the trace logger."
+    handler = logging.FileHandler(fname, "w+")
+    handler.setFormatter(logging.Formatter("%(asctime)s %(message)s"))
+    API_LOGGER.addHandler(handler)
+    API_LOGGER.setLevel(logging.DEBUG)
+    return API_LOGGER
@@ -1,9 +1,12 @@
 from pathlib import Path
+from typing import Dict, List
 from string import Template
-from datetime import datetime
+from datetime import datetime, tzinfo
 
 import re
 
+import pytz
+
 from notion.collection import NotionDate, CollectionRowBlock
 from notion.block import PageBlock
 
@@ -14,16 +17,113 @@ Functions that operate on Notion's `PageBlock`.
 """
 
 
-def page_path(page: PageBlock, dest_dir: Path = Path(".")) -> Path:
-    "Build a .md file path in `dest_dir` based on a Notion page metadata."
-    fname = __title_to_slug(page.title) + ".md"
-    return dest_dir / fname
+# Device names that can't be used as file names on Windows, with or without extension.
+WINDOWS_RESERVED_NAMES = (
+    ["con", "prn", "aux", "nul"]
+    + [f"com{i}" for i in range(1, 10)]
+    + [f"lpt{i}" for i in range(1, 10)]
+)
+
+
+# Strings that are numbers, like `42`, `-1.5` or `1e3`.
+NUMBER = re.compile(r"[-+]?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?")
+
+# Most file systems limit file names to 255 bytes. Keep some room
+# for the extension and the page id suffix added on collisions.
+MAX_SLUG_BYTES = 200
+
+
+def page_path(
+    page: PageBlock,
+    dest_dir: Path = Path("."),
+    unique: bool = False,
+    max_length: int = None,
+) -> Path:
+    """
+    Build a .md file path in `dest_dir` based on a Notion page metadata.
+    With `unique`, a short page id suffix is added to tell apart pages
+    with the same title. With `max_length`, the file name is truncated
+    and suffixed with the page id so that the whole path fits.
+    """
+    fname = __slug_to_filename(__title_to_slug(page.title), page.id)
+    suffix = "-" + page.id.replace("-", "")[:8]
+    available = None if max_length is None else max_length - len(str(dest_dir / ".md"))
+
+    if available is not None and len(fname) + (len(suffix) if unique else 0) > available:
+        if max_length < shortest_page_path(dest_dir):
+            raise ValueError(f"Directory {dest_dir} path doesn't fit in {max_length}.")
+        fname, unique = fname[: available - len(suffix)], True
+
+    if unique:
+        fname += suffix
+    return dest_dir / (fname + ".md")
+
+
+def shortest_page_path(dest_dir: Path) -> int:
+    "Returns the shortest path length `page_path` can fit a page into in `dest_dir`."
+    # One character of the title, and the page id suffix.
+    return len(str(dest_dir / ".md")) + 1 + len("-") + 8
+
+
+def page_paths(
+    pages: List[PageBlock], dest_dir: Path = Path("."), max_length: int = None
+) -> Dict[str, Path]:
+    """
+    Builds .md file paths in `dest_dir` for all the `pages`, keyed by page id.
+    Pages with the same title get a page id suffix, except for the one created
+    first, so that the names don't depend on the order of pages between runs.
+    """
+    same_path = dict()
+    for page in sorted(pages, key=lambda p: (created_timestamp(p), p.id)):
+        path = page_path(page, dest_dir=dest_dir, max_length=max_length)
+        same_path.setdefault(path, []).append(page)
+
+    paths = dict()
+    for path, duplicates in same_path.items():
+        paths[duplicates[0].id] = path
+        for page in duplicates[1:]:
+            paths[page.id] = page_path(
+                page, dest_dir=dest_dir, unique=True, max_length=max_length
+            )
+    return paths
 
 
 def __title_to_slug(title: str) -> str:
     return re.sub(r"[^\w\-]", "", re.sub(r"\s+", "-", title)).lower()
 
 
+def __slug_to_filename(slug: str, page_id: str) -> str:
+    """
+    Makes sure the slug is usable as a file name on all platforms.
+    Falls back to `page_id` for titles that have no word characters,
+    and suffixes names reserved on Windows.
+    """
+    slug = __truncate_utf8(slug, MAX_SLUG_BYTES)
+    if slug.strip("-_") == "":
+        return page_id
+    if slug in WINDOWS_RESERVED_NAMES:
+        return slug + "_"
+    return slug
+
+
+def __truncate_utf8(text: str, max_bytes: int) -> str:
+    "Truncates `text` to at most `max_bytes` of UTF-8 without splitting characters."
+    encoded = text.encode("utf-8")
+    if len(encoded) <= max_bytes:
+        return text
+    return encoded[:max_bytes].decode("utf-8", errors="ignore")
+
+
+def last_edited_timestamp(page: PageBlock) -> float:
+    "Returns the page last edited time as a POSIX timestamp."
+    return int(page.get("last_edited_time")) / 1000
+
+
+def created_timestamp(page: PageBlock) -> float:
+    "Returns the page created time as a POSIX timestamp."
+    return int(page.get("created_time")) / 1000
+
+
 def front_matter(page: CollectionRowBlock, config: Config) -> str:
     "Builds and returns a page front matter in a yaml-like format."
     # Start with all the properties from the page, including formulas and rollups.
@@ -36,51 +136,142 @@ def front_matter(page: CollectionRowBlock, config: Config) -> str:
 
     # Add default published_at if there's no specific property for it.
     if "published_at" not in all_props:
-        last_edited_time = datetime.utcfromtimestamp(
-            int(page.get("last_edited_time")) / 1000
-        )
+        last_edited_time = datetime.utcfromtimestamp(last_edited_timestamp(page))
+        if config.timezone is not None:
+            last_edited_time = pytz.utc.localize(last_edited_time).astimezone(
+                config.timezone
+            )
         all_props["published_at"] = last_edited_time
 
-    # Select only properties that are not empty
-    renderables = {k: v for k, v in all_props.items() if v != ""}
-    return __sanitize_front_matter(renderables)
+    # Add the Notion URL of the page to edit it quickly.
+    if config.notion_url_front_matter and "notion_url" not in all_props:
+        all_props["notion_url"] = page.get_browseable_url()
 
+    # Add Notion users who created and last edited the page, if enabled.
+    if config.author_front_matter:
+        if "author" not in all_props:
+            all_props["author"] = __user_name(page, "created_by")
+        if "last_edited_by" not in all_props:
+            all_props["last_edited_by"] = __user_name(page, "last_edited_by")
 
-def __sanitize_front_matter(items: dict) -> dict:
-    "Sanitizes and returns front matter items as a dictionary."
+    # Formulas and rollups return numbers as strings sometimes.
+    all_props = __coerce_numbers(all_props, page.collection.get_schema_properties())
+
+    renderables = __empty_values(all_props, config.empty_values)
+    return __order_front_matter(
+        __sanitize_front_matter(renderables, config.timezone),
+        config.front_matter_order,
+    )
+
+
+def __coerce_numbers(items: dict, schema: list) -> dict:
+    "Converts numeric strings of formula and rollup properties into numbers in place."
+    computed = [p["slug"] for p in schema if p["type"] in ["formula", "rollup"]]
+    for k, v in items.items():
+        if k in computed and isinstance(v, str) and NUMBER.fullmatch(v.strip()):
+            number = float(v)
+            items[k] = int(number) if number.is_integer() else number
+    return items
+
+
+def __empty_values(items: dict, policy: str) -> dict:
+    """
+    Returns a new dict where empty values are either omitted, or
+    replaced with a typed empty value according to the `policy`.
+    """
+    empty = dict(null=None, empty_string="", empty_list=list())
+    renderables = dict()
+    for k, v in items.items():
+        if v is None or v == "" or v == []:
+            if policy == "omit":
+                continue
+            v = empty[policy.replace("-", "_")]
+        renderables[k] = v
+    return renderables
+
+
+def __order_front_matter(items: dict, order: list) -> dict:
+    """
+    Returns a new dict with the keys listed in `order` first, and the rest
+    sorted alphabetically, so that front matter is stable between runs.
+    """
+    first = [k for k in order if k in items]
+    rest = sorted(k for k in items if k not in first)
+    return {k: items[k] for k in first + rest}
+
+
+def __user_name(page: PageBlock, field: str) -> str:
+    "Returns the full name of the Notion user referenced in the page `field`, or empty string."
+    user_id = page.get(f"{field}_id") or page.get(field)
+    if user_id is None:
+        return ""
+    user = page._client.get_user(user_id)
+    return user.full_name if user is not None else ""
+
+
+def __sanitize_front_matter(items: dict, timezone: tzinfo = None) -> dict:
+    """
+    Sanitizes and returns front matter items as a dictionary.
+    Date times are converted into `timezone` if it's provided.
+    """
     for k, v in items.items():
         if type(v) not in [str, list]:
             if isinstance(v, NotionDate):
-                items[k] = v.start
-            if isinstance(v, bool):
-                items[k] = str(v).lower()
+                items[k] = __convert_timezone(v, timezone)
     return items
 
 
+def __convert_timezone(date: NotionDate, timezone: tzinfo = None):
+    """
+    Returns the start of a Notion date. Date times are localized
+    to the Notion date timezone, or UTC, and converted to `timezone`.
+    """
+    start = date.start
+    if timezone is None or not isinstance(start, datetime):
+        return start
+
+    if start.tzinfo is None:
+        start = pytz.timezone(date.timezone or "UTC").localize(start)
+    return start.astimezone(timezone)
+
+
 def page_url_substitutions(page: PageBlock, config: Config) -> dict:
     "Builds and returns a `dict` of substitutions to build URL to this page in the Blog."
     # Start with a dict from `front_m   subs = front_matter(page, config)
     subs = front_matter(page, config)
 
+    # Booleans are substituted as YAML spells them, and empty values
+    # are substituted as empty strings whatever the empty values policy is.
+    subs = {k: __url_substitution(v) for k, v in subs.items()}
+
     # Grab the config baseurl
     subs["baseurl"] = config["baseurl"]
 
     # FIXME Clean this up into a mapping of callables?
     #
-    if "title" in subs:
+    if subs.get("title"):
         subs["title"] = __title_to_slug(subs["title"])
 
-    if "categories" in subs:
+    if subs.get("categories"):
         subs["categories"] = "/".join(subs["categories"])
     else:
         subs["categories"] = ""
 
-    if "published_at" in subs:
+    if subs.get("published_at"):
         subs["year"], subs["month"], subs["day"], *_ = subs["published_at"].timetuple()
 
     return subs
 
 
+def __url_substitution(value):
+    "Returns the front matter value prepared for permalink substitution."
+    if value is None or value == "" or value == []:
+        return ""
+    if isinstance(value, bool):
+        return str(value).lower()
+    return value
+
+
 def build_page_url(page: PageBlock, pattern: Template, config: Config) -> str:
     "Build the URL string for a given URL pattern and returns it as `str`."
     return pattern.substitute(page_url_substitutions(page, config))
@@ -1,5 +1,6 @@
 from typing import Union
 from pathlib import Path
+from datetime import date, datetime
 
 from jinja2 import (
     Environment,
@@ -16,10 +17,31 @@ from notion.markdown import notion_to_markdown
 
 import re
 import string
+import json
 
 from .config import Config
 from .page import build_page_url
 
+# Notion code block language names that don't match markdown fence identifiers.
+CODE_LANGUAGES = {
+    "plain text": "text",
+    "c++": "cpp",
+    "c#": "csharp",
+    "f#": "fsharp",
+    "objective-c": "objectivec",
+    "visual basic": "vb",
+    "vb.net": "vbnet",
+    "java/c/c++/c#": "java",
+    "markup": "html",
+    "docker": "dockerfile",
+    "webassembly": "wasm",
+}
+
+# Strings that can be written into YAML without quotes: they start with
+# a word character, and don't look like numbers, booleans or nulls.
+YAML_PLAIN_STRING = re.compile(r"^[^\W\d][\w \-./]*$")
+YAML_RESERVED_WORDS = ["true", "false", "yes", "no", "on", "off", "null", "y", "n"]
+
 """
 Provides templates that are used in Notion -> Markdown conversion.
 They're currently not utilized, as the render engine actually uses
@@ -39,6 +61,8 @@ def load_template(
         render_block=__render_block,
         snake_case=__snake_case,
         numbered_list_index=__numbered_list_index,
+        code_language=__code_language,
+        yaml_value=__yaml_value,
         notion_url=__notion_url,
         preprocess_notion_links=__preprocess_notion_links,
     )
@@ -59,6 +83,17 @@ def load_template(
     return env.get_template(f"{name}.md.j2")
 
 
+def supported_block_types() -> list:
+    "Returns the list of block types that have a template."
+    templates = (Path(__file__).parent / "templates/blocks").glob("_*.md.j2")
+    return sorted(t.name[1 : -len(".md.j2")] for t in templates)
+
+
+def block_type(b: block.Block) -> str:
+    "Returns snake_cased block type name, that's also used for it's template name."
+    return __block_type(b)
+
+
 #
 # Helpers
 #
@@ -108,11 +143,29 @@ def __template_name(block: block.Block) -> str:
 @contextfilter
 def __render_block(ctx: Context, block: block.Block) -> str:
     """
-    Jinja filter that wraps the block in it's markdown equivalent if possible,
-    or returns it's title.
+    Jinja filter that renders a block without a template according to
+    the `unsupported_blocks` config: as it's title, an HTML comment,
+    a warning quote, or nothing at all. Raises `ValueError` with `fail`.
     """
+    block_type = __block_type(block)
     if ctx["debug"]:
-        print(f"Unsupported block type: {__block_type(block)} in {ctx['page'].title}.")
+        print(f"Unsupported block type: {block_type} in {ctx['page'].title}.")
+
+    policy = ctx["config"].unsupported_blocks
+    if policy == "fail":
+        raise ValueError(
+            f"Unsupported block type: {block_type} in {ctx['page'].title}: "
+            f"{block.get_browseable_url()}"
+        )
+    if policy == "skip":
+        return ""
+    if policy == "comment":
+        return f"<!-- Unsupported Notion block: {block_type} {block.get_browseable_url()} -->"
+    if policy == "callout":
+        return (
+            f"> ⚠️ Unsupported Notion block: {block_type}, "
+            f"[open in Notion]({block.get_browseable_url()})"
+        )
     return str(block.title)
 
 
@@ -133,6 +186,42 @@ def __numbered_list_index(ctx: Context, this: block.Block) -> str:
     )
 
 
+@contextfilter
+def __code_language(ctx: Context, language: str) -> str:
+    """
+    Jinja filter. Returns the markdown fence identifier for a Notion code block
+    language, using `CODE_LANGUAGES` and overrides from the config.
+    """
+    if language is None:
+        return ""
+
+    language = language.lower()
+    mapping = {**CODE_LANGUAGES, **ctx["config"].code_languages}
+    return mapping.get(language, language.replace(" ", "-"))
+
+
+def __yaml_value(value) -> str:
+    "Jinja filter. Returns the value formatted as a typed YAML scalar or flow list."
+    if value is None:
+        return "null"
+    if isinstance(value, bool):
+        return str(value).lower()
+    if isinstance(value, float) and value.is_integer():
+        return str(int(value))
+    if isinstance(value, (int, float)):
+        return str(value)
+    if isinstance(value, list):
+        return "[" + ", ".join(__yaml_value(v) for v in value) + "]"
+    if isinstance(value, (date, datetime)):
+        return str(value)
+    if not isinstance(value, str):
+        return json.dumps(str(value), ensure_ascii=False)
+
+    if YAML_PLAIN_STRING.match(value) and value.lower() not in YAML_RESERVED_WORDS:
+        return value
+    return json.dumps(value, ensure_ascii=False)
+
+
 def __block_type(block: block.Block) -> str:
     "Jinja filter. Returns snake_cased block name."
     return __snake_case(block.__class__.__name__)[:-6]
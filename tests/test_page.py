@@ -0,0 +1,43 @@
+import unittest
+from pathlib import Path
+
+from notoma.page import page_paths
+
+
+class FakePage:
+    "Just enough of a Notion `PageBlock` to build post paths."
+
+    def __init__(self, id: str, title: str, created_time: int):
+        self.id = id
+        self.title = title
+        self.created_time = created_time
+
+    def get(self, key: str):
+        return dict(created_time=self.created_time)[key]
+
+
+class PagePathsTest(unittest.TestCase):
+    first = FakePage("aaaaaaaa-0000", "Hello World", created_time=1000)
+    second = FakePage("bbbbbbbb-0000", "Hello World", created_time=2000)
+    other = FakePage("cccccccc-0000", "Other", created_time=1500)
+
+    def test_unique_titles_are_not_suffixed(self):
+        paths = page_paths([self.first, self.other], dest_dir=Path("posts"))
+        self.assertEqual(paths[self.first.id], Path("posts/hello-world.md"))
+        self.assertEqual(paths[self.other.id], Path("posts/other.md"))
+
+    def test_duplicates_except_the_oldest_are_suffixed(self):
+        paths = page_paths([self.second, self.first], dest_dir=Path("posts"))
+        self.assertEqual(paths[self.first.id], Path("posts/hello-world.md"))
+        self.assertEqual(paths[self.second.id], Path("posts/hello-world-bbbbbbbb.md"))
+
+    def test_paths_dont_depend_on_pages_order(self):
+        pages = [self.first, self.second, self.other]
+        self.assertEqual(
+            page_paths(pages, dest_dir=Path("posts")),
+            page_paths(list(reversed(pages)), dest_dir=Path("posts")),
+        )
+
+
+if __name__ == "__main__":
+    unittest.main()
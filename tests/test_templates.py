@@ -0,0 +1,45 @@
+import unittest
+from datetime import date, datetime
+
+from notoma import templates
+
+# Private module functions are looked up by name, since they're not exported.
+yaml_value = getattr(templates, "__yaml_value")
+
+
+class YamlValueTest(unittest.TestCase):
+    def test_numbers_and_booleans_are_typed(self):
+        self.assertEqual(yaml_value(42), "42")
+        self.assertEqual(yaml_value(1.0), "1")
+        self.assertEqual(yaml_value(1.5), "1.5")
+        self.assertEqual(yaml_value(True), "true")
+        self.assertEqual(yaml_value(None), "null")
+
+    def test_number_like_strings_are_quoted(self):
+        for value in ["1984", "007", "1e3", "-1", ".5"]:
+            self.assertEqual(yaml_value(value), f'"{value}"')
+
+    def test_reserved_words_are_quoted(self):
+        self.assertEqual(yaml_value("yes"), '"yes"')
+        self.assertEqual(yaml_value("Null"), '"Null"')
+
+    def test_plain_strings_are_not_quoted(self):
+        self.assertEqual(yaml_value("hello world"), "hello world")
+
+    def test_dates_are_not_quoted(self):
+        self.assertEqual(yaml_value(date(2020, 1, 2)), "2020-01-02")
+        self.assertEqual(yaml_value(datetime(2020, 1, 2, 3, 4)), "2020-01-02 03:04:00")
+
+    def test_other_objects_are_quoted(self):
+        class User:
+            def __str__(self):
+                return "Jane: Doe"
+
+        self.assertEqual(yaml_value(User()), '"Jane: Doe"')
+
+    def test_lists_are_flow_sequences(self):
+        self.assertEqual(yaml_value(["a", "1", 2]), '[a, "1", 2]')
+
+
+if __name__ == "__main__":
+    unittest.main()